@@ -0,0 +1,84 @@
+// Package auth issues and validates the bearer tokens that gate the API's
+// HTTP handlers.
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Scopes understood by the API.
+const (
+	ScopeDownloadWrite = "download:write"
+	ScopeJobsRead      = "jobs:read"
+)
+
+// Claims is the payload of an access token issued by Issuer.
+type Claims struct {
+	Email  string   `json:"email"`
+	Scopes []string `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether scopes contains want.
+func HasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Issuer signs and verifies access tokens with a single HMAC key.
+type Issuer struct {
+	signingKey []byte
+	ttl        time.Duration
+}
+
+// NewIssuer creates an Issuer that signs tokens with signingKey and gives
+// them a lifetime of ttl.
+func NewIssuer(signingKey string, ttl time.Duration) *Issuer {
+	return &Issuer{signingKey: []byte(signingKey), ttl: ttl}
+}
+
+// TTL returns the configured token lifetime.
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// Issue mints a signed token carrying email and scopes.
+func (i *Issuer) Issue(email string, scopes []string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Email:  email,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(i.signingKey)
+}
+
+// Parse validates a token string and returns its claims.
+func (i *Issuer) Parse(tokenString string) (*Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return i.signingKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ClientStore is a SQLite-backed table of OAuth2 client credentials, each
+// bound to the email it is allowed to act as.
+type ClientStore struct {
+	db *sql.DB
+}
+
+// OpenClientStore opens (and if necessary creates) the clients database at path.
+func OpenClientStore(path string) (*ClientStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open clients db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	const schema = `
+	CREATE TABLE IF NOT EXISTS clients (
+		id TEXT PRIMARY KEY,
+		secret_hash TEXT NOT NULL,
+		email TEXT NOT NULL,
+		allowed_scopes TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create clients schema: %v", err)
+	}
+
+	return &ClientStore{db: db}, nil
+}
+
+// Close closes the underlying database handle.
+func (s *ClientStore) Close() error {
+	return s.db.Close()
+}
+
+// CreateClient registers a new client credential for email with the given
+// scopes. If id is empty one is generated. It returns the client id and the
+// plaintext secret, which is only ever shown once.
+func (s *ClientStore) CreateClient(id, email string, scopes []string) (string, string, error) {
+	if id == "" {
+		generated, err := randomHex(8)
+		if err != nil {
+			return "", "", err
+		}
+		id = generated
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO clients (id, secret_hash, email, allowed_scopes, created_at) VALUES (?, ?, ?, ?, ?)`,
+		id, hashSecret(secret), email, strings.Join(scopes, ","), time.Now().UTC(),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create client: %v", err)
+	}
+
+	return id, secret, nil
+}
+
+// Authenticate verifies a client id/secret pair and returns the email and
+// scopes it is allowed to act as.
+func (s *ClientStore) Authenticate(id, secret string) (string, []string, error) {
+	row := s.db.QueryRow(`SELECT secret_hash, email, allowed_scopes FROM clients WHERE id = ?`, id)
+
+	var secretHash, email, scopesCSV string
+	if err := row.Scan(&secretHash, &email, &scopesCSV); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, fmt.Errorf("unknown client")
+		}
+		return "", nil, fmt.Errorf("failed to look up client: %v", err)
+	}
+
+	if hashSecret(secret) != secretHash {
+		return "", nil, fmt.Errorf("invalid client secret")
+	}
+
+	var scopes []string
+	if scopesCSV != "" {
+		scopes = strings.Split(scopesCSV, ",")
+	}
+	return email, scopes, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const emailContextKey contextKey = "auth_email"
+
+// RequireScope wraps next so it only runs for requests carrying a bearer
+// token that is valid and grants the wanted scope. The token's email claim
+// is attached to the request context for next to read with EmailFromContext.
+func RequireScope(issuer *Issuer, want string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := issuer.Parse(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		if !HasScope(claims.Scopes, want) {
+			http.Error(w, "Insufficient scope", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), emailContextKey, claims.Email)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// EmailFromContext returns the authenticated caller's email, or "" if none
+// is present (i.e. the request never went through RequireScope).
+func EmailFromContext(ctx context.Context) string {
+	email, _ := ctx.Value(emailContextKey).(string)
+	return email
+}
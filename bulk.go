@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"playwright-downloader/auth"
+	"playwright-downloader/jobs"
+)
+
+// maxBulkUploadBytes caps the multipart upload accepted by /download/bulk,
+// matching the cap writefreely applies to its own bulk import endpoint.
+const maxBulkUploadBytes = 10 << 20 // 10MB
+
+// BulkDownloadRequest is the JSON body accepted by /download/bulk.
+type BulkDownloadRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// BulkItemResult reports what happened to a single URL within a batch.
+// PublicURL is only populated for already-completed (skipped) URLs, whose
+// r2_key is final; a freshly queued job's key still carries a placeholder
+// extension until the asset is downloaded and sniffed, so callers should
+// poll GET /download/bulk/{batch_id} (or GET /jobs/{id}) for its real URL.
+type BulkItemResult struct {
+	URL       string `json:"url"`
+	BatchID   string `json:"batch_id"`
+	JobID     int64  `json:"job_id,omitempty"`
+	PublicURL string `json:"public_url,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// bulkEntry is one line of a bulk import: a URL plus an optional
+// filename override.
+type bulkEntry struct {
+	URL          string
+	NameOverride string
+}
+
+func bulkDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := auth.EmailFromContext(r.Context())
+
+	entries, err := parseBulkRequest(r)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(entries) == 0 {
+		errorResponse(w, "At least one URL is required", http.StatusBadRequest)
+		return
+	}
+
+	if !pool.IsLoggedIn(email) {
+		errorResponse(w, "Not logged in. Please login first.", http.StatusUnauthorized)
+		return
+	}
+
+	completed, err := jobStore.List(email, jobs.StateSucceeded)
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to check existing downloads: %v", err), http.StatusInternalServerError)
+		return
+	}
+	alreadyDone := make(map[string]*jobs.Job, len(completed))
+	for _, job := range completed {
+		alreadyDone[job.URL] = job
+	}
+
+	batchID, err := generateBatchID()
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to start batch: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	seenInBatch := make(map[string]bool, len(entries))
+	results := make([]BulkItemResult, 0, len(entries))
+	for _, entry := range entries {
+		if job, ok := alreadyDone[entry.URL]; ok {
+			results = append(results, BulkItemResult{URL: entry.URL, BatchID: batchID, Skipped: true, PublicURL: publicURLForKey(job.R2Key)})
+			continue
+		}
+		if seenInBatch[entry.URL] {
+			// Duplicate URL within this same upload; skip so two jobs don't
+			// race to write the same R2 object key.
+			results = append(results, BulkItemResult{URL: entry.URL, BatchID: batchID, Skipped: true})
+			continue
+		}
+		seenInBatch[entry.URL] = true
+
+		_, r2Key := generateR2PathNamed(entry.URL, email, entry.NameOverride)
+		jobID, err := jobStore.InsertBatch(entry.URL, email, r2Key, batchID)
+		if err != nil {
+			results = append(results, BulkItemResult{URL: entry.URL, BatchID: batchID, Error: err.Error()})
+			continue
+		}
+
+		results = append(results, BulkItemResult{URL: entry.URL, BatchID: batchID, JobID: jobID})
+	}
+
+	jsonResponse(w, results)
+}
+
+func bulkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batchID := strings.TrimPrefix(r.URL.Path, "/download/bulk/")
+	batchJobs, err := jobStore.ListByBatch(batchID)
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to load batch: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(batchJobs) == 0 {
+		errorResponse(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	counts := map[string]int{}
+	for _, job := range batchJobs {
+		counts[job.State]++
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"batch_id":  batchID,
+		"total":     len(batchJobs),
+		"queued":    counts[jobs.StateQueued],
+		"running":   counts[jobs.StateRunning],
+		"succeeded": counts[jobs.StateSucceeded],
+		"failed":    counts[jobs.StateFailed],
+		"jobs":      newJobViews(batchJobs),
+	})
+}
+
+// parseBulkRequest accepts either a JSON body ({"urls"}) or a
+// multipart/form-data upload with a "file" field holding a .txt/.csv list
+// of URLs.
+func parseBulkRequest(r *http.Request) ([]bulkEntry, error) {
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		return parseBulkMultipart(r)
+	}
+
+	var req BulkDownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload")
+	}
+
+	entries := make([]bulkEntry, 0, len(req.URLs))
+	for _, u := range req.URLs {
+		if u == "" {
+			continue
+		}
+		entries = append(entries, bulkEntry{URL: u})
+	}
+	return entries, nil
+}
+
+func parseBulkMultipart(r *http.Request) ([]bulkEntry, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBulkUploadBytes)
+	if err := r.ParseMultipartForm(maxBulkUploadBytes); err != nil {
+		return nil, fmt.Errorf("failed to parse multipart form: %v", err)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("missing file upload")
+	}
+	defer file.Close()
+
+	return parseBulkFile(file)
+}
+
+// parseBulkFile reads one URL per line, optionally followed by a
+// comma-separated filename override: "<url>" or "<url>,<filename>".
+func parseBulkFile(r io.Reader) ([]bulkEntry, error) {
+	var entries []bulkEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 2)
+		entry := bulkEntry{URL: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			entry.NameOverride = strings.TrimSpace(parts[1])
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	return entries, nil
+}
+
+func generateBatchID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate batch id: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
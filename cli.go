@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"playwright-downloader/auth"
+)
+
+// runCreateClientCLI implements the "create-client" subcommand:
+//
+//	playwright-api create-client --email=user@example.com --scopes=download:write,jobs:read [--id=custom-id]
+//
+// It registers a new OAuth2 client credential and prints the generated id
+// and secret, which are only ever shown once.
+func runCreateClientCLI(args []string) {
+	fs := flag.NewFlagSet("create-client", flag.ExitOnError)
+	email := fs.String("email", "", "email the client is allowed to act as (required)")
+	scopesCSV := fs.String("scopes", "", "comma-separated scopes to grant, e.g. download:write,jobs:read (required)")
+	id := fs.String("id", "", "client id to use (generated if omitted)")
+	fs.Parse(args)
+
+	if *email == "" || *scopesCSV == "" {
+		log.Fatal("❌ --email and --scopes are required")
+	}
+
+	var scopes []string
+	for _, s := range strings.Split(*scopesCSV, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+
+	store, err := auth.OpenClientStore(getClientsDBPath())
+	if err != nil {
+		log.Fatalf("❌ Failed to open clients database: %v", err)
+	}
+	defer store.Close()
+
+	clientID, secret, err := store.CreateClient(*id, *email, scopes)
+	if err != nil {
+		log.Fatalf("❌ Failed to create client: %v", err)
+	}
+
+	fmt.Printf("Client created:\n  id:     %s\n  secret: %s\n  email:  %s\n  scopes: %s\n", clientID, secret, *email, strings.Join(scopes, ","))
+}
@@ -0,0 +1,269 @@
+// Package contextpool manages one Playwright browser context per user
+// email so downloads for different users can run in parallel instead of
+// serializing on a single shared session.
+package contextpool
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// entry holds one user's live browser context plus its pool bookkeeping.
+// All fields are protected by the owning Pool's mu, not a lock of their own,
+// so every access to loggedIn/lastUsed/refCount must hold p.mu.
+type entry struct {
+	email    string
+	context  playwright.BrowserContext
+	loggedIn bool
+	lastUsed time.Time
+	refCount int
+}
+
+// Pool caps the number of live browser contexts, evicting the least
+// recently used idle one (persisting its storage state first) when a new
+// user needs a context and the pool is full.
+type Pool struct {
+	mu       sync.Mutex
+	freed    *sync.Cond
+	browser  playwright.Browser
+	stateDir string
+	maxSize  int
+	entries  map[string]*entry
+}
+
+// UserInfo summarizes one cached user for the /users endpoint.
+type UserInfo struct {
+	Email    string    `json:"email"`
+	LoggedIn bool      `json:"logged_in"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// NewPool creates a pool that keeps at most maxSize contexts alive at
+// once, persisting storage state under stateDir.
+func NewPool(browser playwright.Browser, stateDir string, maxSize int) *Pool {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	p := &Pool{
+		browser:  browser,
+		stateDir: stateDir,
+		maxSize:  maxSize,
+		entries:  make(map[string]*entry),
+	}
+	p.freed = sync.NewCond(&p.mu)
+	return p
+}
+
+// StoragePath returns the per-user storage state file path for email.
+func (p *Pool) StoragePath(email string) string {
+	sum := sha1.Sum([]byte(email))
+	return filepath.Join(p.stateDir, fmt.Sprintf("freepik_storage_state_%s.json", hex.EncodeToString(sum[:])))
+}
+
+// Acquire returns the context for email, creating it (and evicting an idle
+// context if the pool is full) if necessary. If the pool is full and every
+// context is currently in use, Acquire blocks until one is Released so
+// maxSize is a hard cap on live contexts, not just on idle ones. Every
+// Acquire must be paired with a Release.
+func (p *Pool) Acquire(email string) (playwright.BrowserContext, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.entries[email]
+	if !ok {
+		for !ok && len(p.entries) >= p.maxSize {
+			evicted, err := p.evictLocked()
+			if err != nil {
+				return nil, false, err
+			}
+			if !evicted {
+				// Every context is currently in use; wait for a Release or
+				// Close to free one up rather than exceeding maxSize.
+				p.freed.Wait()
+			}
+			// Another caller may have created this email's context while
+			// we waited.
+			e, ok = p.entries[email]
+		}
+	}
+	if !ok {
+		var err error
+		e, err = p.createLocked(email)
+		if err != nil {
+			return nil, false, err
+		}
+		p.entries[email] = e
+	}
+	e.refCount++
+	e.lastUsed = time.Now()
+	ctx, loggedIn := e.context, e.loggedIn
+
+	return ctx, loggedIn, nil
+}
+
+// IsLoggedIn reports whether email has a usable login, without creating or
+// blocking on a pool slot the way Acquire does. It checks the live entry
+// first, falling back to the presence of a persisted storage state file for
+// a user who isn't currently cached in the pool.
+func (p *Pool) IsLoggedIn(email string) bool {
+	p.mu.Lock()
+	e, ok := p.entries[email]
+	loggedIn := ok && e.loggedIn
+	p.mu.Unlock()
+	if ok {
+		return loggedIn
+	}
+
+	_, err := os.Stat(p.StoragePath(email))
+	return err == nil
+}
+
+// Release signals that the caller is done using the context for email.
+func (p *Pool) Release(email string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[email]; ok {
+		e.refCount--
+		e.lastUsed = time.Now()
+	}
+	p.freed.Broadcast()
+}
+
+// MarkLoggedIn records the login state for email and persists its storage
+// state to disk so the session survives a restart.
+func (p *Pool) MarkLoggedIn(email string, loggedIn bool) error {
+	p.mu.Lock()
+	e, ok := p.entries[email]
+	if ok {
+		e.loggedIn = loggedIn
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no context for %s", email)
+	}
+
+	if !loggedIn {
+		return nil
+	}
+	if _, err := e.context.StorageState(p.StoragePath(email)); err != nil {
+		return fmt.Errorf("failed to save storage state: %v", err)
+	}
+	return nil
+}
+
+// Close closes the context for email (if any) and removes its storage
+// state file, used by the /logout endpoint.
+func (p *Pool) Close(email string) error {
+	p.mu.Lock()
+	e, ok := p.entries[email]
+	if ok {
+		delete(p.entries, email)
+	}
+	p.freed.Broadcast()
+	p.mu.Unlock()
+
+	if ok {
+		if err := e.context.Close(); err != nil {
+			log.Printf("⚠️ Failed to close context for %s: %v", email, err)
+		}
+	}
+
+	if err := os.Remove(p.StoragePath(email)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove storage state: %v", err)
+	}
+	return nil
+}
+
+// List returns the cached users and their login state, used by the
+// /users endpoint.
+func (p *Pool) List() []UserInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	users := make([]UserInfo, 0, len(p.entries))
+	for _, e := range p.entries {
+		users = append(users, UserInfo{Email: e.email, LoggedIn: e.loggedIn, LastUsed: e.lastUsed})
+	}
+	return users
+}
+
+// createLocked creates a new context for email, loading its storage state
+// from disk if present. The caller must hold p.mu.
+func (p *Pool) createLocked(email string) (*entry, error) {
+	log.Printf("🆕 Creating browser context for %s...", email)
+
+	opts := playwright.BrowserNewContextOptions{
+		UserAgent: playwright.String("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
+		Viewport: &playwright.Size{
+			Width:  1920,
+			Height: 1080,
+		},
+		Locale:     playwright.String("en-US"),
+		TimezoneId: playwright.String("America/New_York"),
+		ExtraHttpHeaders: map[string]string{
+			"Accept-Language": "en-US,en;q=0.9",
+		},
+	}
+
+	loggedIn := false
+	storageStateFile := p.StoragePath(email)
+	if _, err := os.Stat(storageStateFile); err == nil {
+		opts.StorageStatePath = playwright.String(storageStateFile)
+		loggedIn = true
+	}
+
+	ctx, err := p.browser.NewContext(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser context: %v", err)
+	}
+
+	return &entry{
+		email:    email,
+		context:  ctx,
+		loggedIn: loggedIn,
+		lastUsed: time.Now(),
+	}, nil
+}
+
+// evictLocked closes the least recently used idle context to make room for
+// a new one. The caller must hold p.mu. It reports whether it evicted
+// anything; evicted is false (not an error) if every context is currently
+// in use.
+func (p *Pool) evictLocked() (evicted bool, err error) {
+	var oldestEmail string
+	var oldest time.Time
+
+	for email, e := range p.entries {
+		if e.refCount > 0 {
+			continue
+		}
+		if oldestEmail == "" || e.lastUsed.Before(oldest) {
+			oldestEmail = email
+			oldest = e.lastUsed
+		}
+	}
+	if oldestEmail == "" {
+		return false, nil
+	}
+
+	e := p.entries[oldestEmail]
+	if e.loggedIn {
+		if _, err := e.context.StorageState(p.StoragePath(oldestEmail)); err != nil {
+			log.Printf("⚠️ Failed to persist storage state for %s before eviction: %v", oldestEmail, err)
+		}
+	}
+	if err := e.context.Close(); err != nil {
+		log.Printf("⚠️ Failed to close evicted context for %s: %v", oldestEmail, err)
+	}
+	log.Printf("♻️ Evicted idle context for %s", oldestEmail)
+	delete(p.entries, oldestEmail)
+	return true, nil
+}
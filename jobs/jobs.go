@@ -0,0 +1,314 @@
+// Package jobs implements a durable download job queue backed by SQLite.
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Job states.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// DefaultMaxAttempts is the number of attempts a job gets before it is
+// marked permanently failed.
+const DefaultMaxAttempts = 5
+
+// Job is a single download job row.
+type Job struct {
+	ID               int64      `json:"id"`
+	URL              string     `json:"url"`
+	Email            string     `json:"email"`
+	R2Key            string     `json:"r2_key"`
+	State            string     `json:"state"`
+	Attempts         int        `json:"attempts"`
+	LastError        string     `json:"last_error,omitempty"`
+	NextAttemptAt    *time.Time `json:"next_attempt_at,omitempty"`
+	BatchID          string     `json:"batch_id,omitempty"`
+	UploadBytes      int64      `json:"upload_bytes"`
+	UploadTotalBytes int64      `json:"upload_total_bytes"`
+	ChecksumSHA256   string     `json:"checksum_sha256,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// Store is a SQLite-backed job queue.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (and if necessary creates) the jobs database at path.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open jobs db: %v", err)
+	}
+	// SQLite only supports one writer at a time; serialize access from Go's side too.
+	db.SetMaxOpenConns(1)
+
+	const schema = `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		email TEXT NOT NULL,
+		r2_key TEXT NOT NULL,
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at DATETIME,
+		batch_id TEXT,
+		upload_bytes INTEGER NOT NULL DEFAULT 0,
+		upload_total_bytes INTEGER NOT NULL DEFAULT 0,
+		checksum_sha256 TEXT,
+		created_at DATETIME NOT NULL,
+		completed_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_email ON jobs(email);
+	CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state);
+	CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON jobs(batch_id);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create jobs schema: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database handle.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Insert creates a new queued job and returns its id.
+func (s *Store) Insert(url, email, r2Key string) (int64, error) {
+	return s.InsertBatch(url, email, r2Key, "")
+}
+
+// InsertBatch creates a new queued job tagged with batchID so its progress
+// can later be queried as part of that batch. Pass an empty batchID for a
+// standalone job.
+func (s *Store) InsertBatch(url, email, r2Key, batchID string) (int64, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO jobs (url, email, r2_key, state, attempts, batch_id, created_at) VALUES (?, ?, ?, ?, 0, ?, ?)`,
+		url, email, r2Key, StateQueued, nullable(batchID), time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert job: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+// Get fetches a job by id.
+func (s *Store) Get(id int64) (*Job, error) {
+	row := s.db.QueryRow(
+		`SELECT id, url, email, r2_key, state, attempts, last_error, next_attempt_at, batch_id, upload_bytes, upload_total_bytes, checksum_sha256, created_at, completed_at FROM jobs WHERE id = ?`,
+		id,
+	)
+	return scanJob(row)
+}
+
+// List returns jobs optionally filtered by email and/or state.
+func (s *Store) List(email, state string) ([]*Job, error) {
+	query := `SELECT id, url, email, r2_key, state, attempts, last_error, next_attempt_at, batch_id, upload_bytes, upload_total_bytes, checksum_sha256, created_at, completed_at FROM jobs WHERE 1=1`
+	var args []interface{}
+	if email != "" {
+		query += ` AND email = ?`
+		args = append(args, email)
+	}
+	if state != "" {
+		query += ` AND state = ?`
+		args = append(args, state)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobList []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobList = append(jobList, job)
+	}
+	return jobList, rows.Err()
+}
+
+// ListByBatch returns every job inserted under the given batch id, oldest first.
+func (s *Store) ListByBatch(batchID string) ([]*Job, error) {
+	rows, err := s.db.Query(
+		`SELECT id, url, email, r2_key, state, attempts, last_error, next_attempt_at, batch_id, upload_bytes, upload_total_bytes, checksum_sha256, created_at, completed_at
+		 FROM jobs WHERE batch_id = ? ORDER BY created_at ASC`,
+		batchID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batch jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobList []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobList = append(jobList, job)
+	}
+	return jobList, rows.Err()
+}
+
+// Dequeue atomically claims the oldest queued job and marks it running.
+// It returns (nil, nil) if no job is queued.
+func (s *Store) Dequeue() (*Job, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin dequeue tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(
+		`SELECT id, url, email, r2_key, state, attempts, last_error, next_attempt_at, batch_id, upload_bytes, upload_total_bytes, checksum_sha256, created_at, completed_at
+		 FROM jobs WHERE state = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?) ORDER BY created_at ASC LIMIT 1`,
+		StateQueued, time.Now().UTC(),
+	)
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE jobs SET state = ?, next_attempt_at = NULL WHERE id = ?`, StateRunning, job.ID); err != nil {
+		return nil, fmt.Errorf("failed to mark job running: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit dequeue tx: %v", err)
+	}
+
+	job.State = StateRunning
+	return job, nil
+}
+
+// UpdateR2Key updates the object key a job uploads to, used once the real
+// file extension is known after the download completes.
+func (s *Store) UpdateR2Key(id int64, r2Key string) error {
+	_, err := s.db.Exec(`UPDATE jobs SET r2_key = ? WHERE id = ?`, r2Key, id)
+	return err
+}
+
+// UpdateUploadProgress records how many of the total bytes of the upload to
+// R2 have been sent so far. It is safe to call repeatedly from within a
+// running upload to expose live progress on the job row.
+func (s *Store) UpdateUploadProgress(id, uploaded, total int64) error {
+	_, err := s.db.Exec(
+		`UPDATE jobs SET upload_bytes = ?, upload_total_bytes = ? WHERE id = ?`,
+		uploaded, total, id,
+	)
+	return err
+}
+
+// SetChecksum records the SHA256 checksum computed over the uploaded bytes
+// once the upload has completed.
+func (s *Store) SetChecksum(id int64, checksum string) error {
+	_, err := s.db.Exec(`UPDATE jobs SET checksum_sha256 = ? WHERE id = ?`, checksum, id)
+	return err
+}
+
+// MarkSucceeded marks a job as completed successfully.
+func (s *Store) MarkSucceeded(id int64) error {
+	_, err := s.db.Exec(
+		`UPDATE jobs SET state = ?, completed_at = ? WHERE id = ?`,
+		StateSucceeded, time.Now().UTC(), id,
+	)
+	return err
+}
+
+// MarkFailed records a failed attempt. If attempts have reached maxAttempts
+// the job is moved to the terminal failed state, otherwise it is put back on
+// the queue with next_attempt_at set to notBefore so Dequeue won't hand it to
+// another worker until the backoff delay has actually elapsed. It returns
+// whether the failure was terminal.
+func (s *Store) MarkFailed(id int64, lastErr string, maxAttempts int, notBefore time.Time) (terminal bool, err error) {
+	row := s.db.QueryRow(`SELECT attempts FROM jobs WHERE id = ?`, id)
+	var attempts int
+	if err := row.Scan(&attempts); err != nil {
+		return false, fmt.Errorf("failed to read job attempts: %v", err)
+	}
+	attempts++
+
+	if attempts >= maxAttempts {
+		_, err := s.db.Exec(
+			`UPDATE jobs SET state = ?, attempts = ?, last_error = ?, completed_at = ? WHERE id = ?`,
+			StateFailed, attempts, lastErr, time.Now().UTC(), id,
+		)
+		return true, err
+	}
+
+	_, err = s.db.Exec(
+		`UPDATE jobs SET state = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+		StateQueued, attempts, lastErr, notBefore.UTC(), id,
+	)
+	return false, err
+}
+
+// RequeueStaleRunning puts any job stuck in the running state back onto the
+// queue. It should be called once on startup so a restart while jobs were
+// in flight doesn't lose them.
+func (s *Store) RequeueStaleRunning() (int64, error) {
+	res, err := s.db.Exec(`UPDATE jobs SET state = ? WHERE state = ?`, StateQueued, StateRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale jobs: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var lastError sql.NullString
+	var nextAttemptAt sql.NullTime
+	var batchID sql.NullString
+	var checksum sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(
+		&job.ID, &job.URL, &job.Email, &job.R2Key, &job.State, &job.Attempts, &lastError, &nextAttemptAt, &batchID,
+		&job.UploadBytes, &job.UploadTotalBytes, &checksum, &job.CreatedAt, &completedAt,
+	); err != nil {
+		return nil, err
+	}
+	job.LastError = lastError.String
+	job.BatchID = batchID.String
+	job.ChecksumSHA256 = checksum.String
+	if nextAttemptAt.Valid {
+		job.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
+
+// nullable converts an empty string to a real SQL NULL so batch_id stays
+// unset for standalone jobs instead of storing "".
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// ProcessFunc runs a single job and returns an error if it failed.
+type ProcessFunc func(job *Job) error
+
+// pollInterval is how long an idle worker waits before checking the queue again.
+const pollInterval = 2 * time.Second
+
+// maxBackoff caps the exponential retry delay between attempts.
+const maxBackoff = 60 * time.Second
+
+// Pool is a fixed-size worker pool that drains queued jobs from a Store.
+type Pool struct {
+	store       *Store
+	concurrency int
+	maxAttempts int
+	process     ProcessFunc
+}
+
+// NewPool creates a worker pool of the given concurrency. Jobs that fail are
+// retried with exponential backoff up to maxAttempts before being marked
+// permanently failed.
+func NewPool(store *Store, concurrency, maxAttempts int, process ProcessFunc) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &Pool{
+		store:       store,
+		concurrency: concurrency,
+		maxAttempts: maxAttempts,
+		process:     process,
+	}
+}
+
+// Start launches the worker goroutines. It returns immediately.
+func (p *Pool) Start() {
+	for i := 0; i < p.concurrency; i++ {
+		go p.runWorker(i)
+	}
+}
+
+func (p *Pool) runWorker(id int) {
+	for {
+		job, err := p.store.Dequeue()
+		if err != nil {
+			log.Printf("⚠️ worker %d: failed to dequeue job: %v", id, err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		log.Printf("🚀 worker %d: starting job %d (%s)", id, job.ID, job.URL)
+		if err := p.process(job); err != nil {
+			p.handleFailure(id, job, err)
+			continue
+		}
+
+		if err := p.store.MarkSucceeded(job.ID); err != nil {
+			log.Printf("⚠️ worker %d: failed to mark job %d succeeded: %v", id, job.ID, err)
+			continue
+		}
+		log.Printf("✅ worker %d: job %d succeeded", id, job.ID)
+	}
+}
+
+func (p *Pool) handleFailure(id int, job *Job, jobErr error) {
+	backoff := backoffForAttempt(job.Attempts + 1)
+	terminal, err := p.store.MarkFailed(job.ID, jobErr.Error(), p.maxAttempts, time.Now().Add(backoff))
+	if err != nil {
+		log.Printf("⚠️ worker %d: failed to record failure for job %d: %v", id, job.ID, err)
+		return
+	}
+	if terminal {
+		log.Printf("❌ worker %d: job %d failed permanently: %v", id, job.ID, jobErr)
+		return
+	}
+
+	log.Printf("⚠️ worker %d: job %d failed (attempt %d): %v — retrying in %s", id, job.ID, job.Attempts+1, jobErr, backoff)
+}
+
+func backoffForAttempt(attempt int) time.Duration {
+	backoff := time.Second << uint(attempt)
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
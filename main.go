@@ -1,15 +1,21 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"context"
@@ -17,34 +23,41 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
+	"github.com/mssola/user_agent"
 	"github.com/playwright-community/playwright-go"
+
+	"playwright-downloader/auth"
+	"playwright-downloader/contextpool"
+	"playwright-downloader/jobs"
 )
 
 // Global variables
 var (
-	browser          playwright.Browser
-	browserContext   playwright.BrowserContext
-	contextMux       sync.RWMutex
-	isLoggedIn       bool
-	currentUserEmail string
+	browser playwright.Browser
+	pool    *contextpool.Pool
+
+	jobStore    *jobs.Store
+	clientStore *auth.ClientStore
+	issuer      *auth.Issuer
 )
 
 type DownloadRequest struct {
-	URL   string `json:"url"`
-	Email string `json:"email"`
+	URL string `json:"url"`
 }
 
 type DownloadResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	File    string `json:"file,omitempty"`
+	JobID   int64  `json:"job_id,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
@@ -55,6 +68,11 @@ type LoginResponse struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "create-client" {
+		runCreateClientCLI(os.Args[2:])
+		return
+	}
+
 	log.Println("1. Starting Playwright Core...")
 	pw, err := playwright.Run()
 	if err != nil {
@@ -75,28 +93,46 @@ func main() {
 		log.Fatalf("❌ Failed to launch browser: %v", err)
 	}
 
-	// Try to load existing storage state
-	storageStateFile := getStorageStatePath()
-	if _, err := os.Stat(storageStateFile); err == nil {
-		log.Println("📁 Loading existing storage state...")
-		browserContext, err = browser.NewContext(playwright.BrowserNewContextOptions{
-			StorageStatePath: playwright.String(storageStateFile),
-		})
-		if err != nil {
-			log.Printf("⚠️ Failed to load storage state: %v", err)
-			createNewContext()
-		} else {
-			isLoggedIn = true
-			log.Println("✅ Storage state loaded successfully")
-		}
-	} else {
-		createNewContext()
+	poolSize := getEnvInt("CONTEXT_POOL_SIZE", 5)
+	log.Printf("3. Starting browser context pool (size=%d)...", poolSize)
+	pool = contextpool.NewPool(browser, getStateDir(), poolSize)
+
+	log.Println("4. Opening job queue...")
+	jobStore, err = jobs.Open(getJobsDBPath())
+	if err != nil {
+		log.Fatalf("❌ Failed to open jobs database: %v", err)
+	}
+
+	if n, err := jobStore.RequeueStaleRunning(); err != nil {
+		log.Printf("⚠️ Failed to requeue stale running jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("🔁 Requeued %d job(s) left running from a previous run", n)
+	}
+
+	concurrency := getEnvInt("WORKER_CONCURRENCY", 2)
+	log.Printf("5. Starting worker pool (concurrency=%d)...", concurrency)
+	workerPool := jobs.NewPool(jobStore, concurrency, jobs.DefaultMaxAttempts, processDownloadJob)
+	workerPool.Start()
+
+	log.Println("6. Opening client store and token issuer...")
+	clientStore, err = auth.OpenClientStore(getClientsDBPath())
+	if err != nil {
+		log.Fatalf("❌ Failed to open clients database: %v", err)
 	}
+	issuer = auth.NewIssuer(getEnv("JWT_SIGNING_KEY", "insecure-dev-signing-key"), getEnvDuration("JWT_TTL", time.Hour))
 
-	http.HandleFunc("/download", downloadHandler)
+	http.HandleFunc("/oauth/token", oauthTokenHandler)
+	http.HandleFunc("/download", auth.RequireScope(issuer, auth.ScopeDownloadWrite, downloadHandler))
+	http.HandleFunc("/download/bulk", auth.RequireScope(issuer, auth.ScopeDownloadWrite, bulkDownloadHandler))
+	http.HandleFunc("/download/bulk/", auth.RequireScope(issuer, auth.ScopeJobsRead, bulkStatusHandler))
 	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/login", auth.RequireScope(issuer, auth.ScopeDownloadWrite, loginHandler))
+	http.HandleFunc("/logout", auth.RequireScope(issuer, auth.ScopeDownloadWrite, logoutHandler))
+	http.HandleFunc("/status", auth.RequireScope(issuer, auth.ScopeJobsRead, statusHandler))
+	http.HandleFunc("/users", auth.RequireScope(issuer, auth.ScopeJobsRead, usersHandler))
+	http.HandleFunc("/jobs", auth.RequireScope(issuer, auth.ScopeJobsRead, jobsListHandler))
+	http.HandleFunc("/jobs/", auth.RequireScope(issuer, auth.ScopeJobsRead, jobGetHandler))
+	http.HandleFunc("/files/", auth.RequireScope(issuer, auth.ScopeJobsRead, filesHandler))
 
 	port := getEnv("PORT", "8080")
 	log.Printf("🚀 Starting download API server on port %s", port)
@@ -106,63 +142,109 @@ func main() {
 	}
 }
 
-func createNewContext() {
-	log.Println("🆕 Creating new browser context...")
-	var err error
-	browserContext, err = browser.NewContext(playwright.BrowserNewContextOptions{
-		UserAgent: playwright.String("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
-		Viewport: &playwright.Size{
-			Width:  1920,
-			Height: 1080,
-		},
-		Locale:     playwright.String("en-US"),
-		TimezoneId: playwright.String("America/New_York"),
-		ExtraHttpHeaders: map[string]string{
-			"Accept-Language": "en-US,en;q=0.9",
-		},
-	})
+func getStateDir() string {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("❌ Failed to create browser context: %v", err)
+		homeDir = "."
 	}
-	isLoggedIn = false
+	return homeDir
 }
 
-func getStorageStatePath() string {
+func getJobsDBPath() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		homeDir = "."
 	}
-	return filepath.Join(homeDir, "freepik_storage_state.json")
+	return getEnv("JOBS_DB_PATH", filepath.Join(homeDir, "playwright_jobs.db"))
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func getClientsDBPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "."
+	}
+	return getEnv("CLIENTS_DB_PATH", filepath.Join(homeDir, "playwright_clients.db"))
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid value for %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// OAuthTokenRequest is the body accepted by /oauth/token.
+type OAuthTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// OAuthTokenResponse is a standard OAuth2 client-credentials token response.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+func oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req LoginRequest
+	var req OAuthTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonResponse(w, LoginResponse{Success: false, Error: "Invalid JSON payload"})
+		errorResponse(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
-	// Use default credentials if not provided
-	if req.Email == "" {
-		req.Email = "mymymy@gmail.com"
+	email, scopes, err := clientStore.Authenticate(req.ClientID, req.ClientSecret)
+	if err != nil {
+		errorResponse(w, "Invalid client credentials", http.StatusUnauthorized)
+		return
 	}
 
-	contextMux.Lock()
-	currentUserEmail = req.Email
-	contextMux.Unlock()
+	token, err := issuer.Issue(email, scopes)
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to issue token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(issuer.TTL().Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, LoginResponse{Success: false, Error: "Invalid JSON payload"})
+		return
+	}
 
 	if req.Password == "" {
 		req.Password = "mypassword"
 	}
 
-	log.Printf("🔐 Login request for email: %s", req.Email)
+	email := auth.EmailFromContext(r.Context())
+	log.Printf("🔐 Login request for email: %s", email)
 
-	if err := performLogin(req.Email, req.Password); err != nil {
+	if err := performLogin(email, req.Password); err != nil {
 		jsonResponse(w, LoginResponse{Success: false, Error: fmt.Sprintf("Login failed: %v", err)})
 		return
 	}
@@ -171,8 +253,11 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func performLogin(email, password string) error {
-	contextMux.Lock()
-	defer contextMux.Unlock()
+	browserContext, _, err := pool.Acquire(email)
+	if err != nil {
+		return fmt.Errorf("failed to acquire browser context: %v", err)
+	}
+	defer pool.Release(email)
 
 	log.Println("🌐 Starting login sequence...")
 
@@ -311,12 +396,10 @@ func performLogin(email, password string) error {
 
 	// Step 8: Save storage state
 	log.Println("8. Saving storage state...")
-	storageStateFile := getStorageStatePath()
-	if _, err := browserContext.StorageState(storageStateFile); err != nil {
+	if err := pool.MarkLoggedIn(email, true); err != nil {
 		return fmt.Errorf("failed to save storage state: %v", err)
 	}
 
-	isLoggedIn = true
 	log.Println("✅ Login successful and storage state saved!")
 	return nil
 }
@@ -338,34 +421,153 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Email == "" {
-		errorResponse(w, "Email is required for file storage", http.StatusBadRequest)
-		return
-	}
-
+	email := auth.EmailFromContext(r.Context())
 	log.Printf("📥 Received download request for: %s", req.URL)
 
-	// Check if we're logged in
-	contextMux.RLock()
-	loggedIn := isLoggedIn
-	email := currentUserEmail
-	contextMux.RUnlock()
-
-	if !loggedIn {
+	// Check if this user is logged in without acquiring a full browser
+	// context for it (that's expensive, and Acquire now blocks when the
+	// pool is full and every context is busy).
+	if !pool.IsLoggedIn(email) {
 		errorResponse(w, "Not logged in. Please login first.", http.StatusUnauthorized)
 		return
 	}
 
-	// 1. Generate the URL and Key immediately
-	publicURL, r2ObjectKey := generateR2Path(req.URL, email)
+	// 1. Generate the object key immediately. Its extension is only a
+	// placeholder until the asset is downloaded and sniffed, so we don't
+	// hand back a public URL built from it here — poll GET /jobs/{id} for
+	// the real one once the job succeeds.
+	_, r2ObjectKey := generateR2Path(req.URL, email)
 
-	go processDownload(req.URL, r2ObjectKey)
+	// 2. Persist the job so it survives a restart and can be polled
+	jobID, err := jobStore.Insert(req.URL, email, r2ObjectKey)
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to queue download: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	jsonResponse(w, DownloadResponse{
 		Success: true,
-		Message: "Download started",
-		File:    publicURL, // The constructed URL
+		Message: "Download queued. Poll GET /jobs/{id} for the final public URL.",
+		JobID:   jobID,
+	})
+}
+
+func jobsListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := auth.EmailFromContext(r.Context())
+	state := r.URL.Query().Get("state")
+
+	list, err := jobStore.List(email, state)
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to list jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, newJobViews(list))
+}
+
+func jobGetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		errorResponse(w, "Invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobStore.Get(id)
+	if err != nil {
+		errorResponse(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if job.Email != auth.EmailFromContext(r.Context()) {
+		errorResponse(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, newJobView(job))
+}
+
+// jobView adds the job's current public URL to its JSON representation.
+// It's computed from r2_key rather than trusted at enqueue time, since
+// r2_key (and therefore the URL) changes once processDownloadJob corrects
+// the placeholder extension for the real, sniffed asset type.
+type jobView struct {
+	*jobs.Job
+	PublicURL string `json:"public_url,omitempty"`
+}
+
+func newJobView(job *jobs.Job) jobView {
+	return jobView{Job: job, PublicURL: publicURLForKey(job.R2Key)}
+}
+
+func newJobViews(list []*jobs.Job) []jobView {
+	views := make([]jobView, len(list))
+	for i, job := range list {
+		views[i] = newJobView(job)
+	}
+	return views
+}
+
+// filesHandler proxies a downloaded asset out of R2 by key, so a caller
+// never needs R2 credentials of their own. It only serves keys under the
+// authenticated caller's own email prefix.
+func filesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/files/")
+	email := auth.EmailFromContext(r.Context())
+	if key == "" || !strings.HasPrefix(key, url.QueryEscape(email)+"/") {
+		errorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	client, err := newR2Client()
+	if err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to reach storage: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	obj, err := client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(getEnv("R2_BUCKET_NAME", "")),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		errorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer obj.Body.Close()
+
+	contentType := aws.ToString(obj.ContentType)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Edge, IE and Safari are unreliable about honoring Content-Disposition
+	// for anything other than application/octet-stream, so force it for
+	// them rather than trust the stored Content-Type. This follows the
+	// pattern mattermost's writeFileResponse uses for the same browsers.
+	ua := user_agent.New(r.Header.Get("User-Agent"))
+	switch name, _ := ua.Browser(); name {
+	case "Edge", "Internet Explorer", "Safari":
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(key)))
+	io.Copy(w, obj.Body)
 }
 
 func statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -374,40 +576,133 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	contextMux.RLock()
-	defer contextMux.RUnlock()
+	users := pool.List()
+	loggedIn := 0
+	for _, u := range users {
+		if u.LoggedIn {
+			loggedIn++
+		}
+	}
 
 	jsonResponse(w, map[string]interface{}{
-		"logged_in": isLoggedIn,
-		"status":    "ready",
+		"status":       "ready",
+		"cached_users": len(users),
+		"logged_in":    loggedIn,
 	})
 }
 
-func processDownload(targetURL, r2Key string) {
-	log.Printf("🚀 Starting download for %s -> Key: %s", targetURL, r2Key)
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
+	email := auth.EmailFromContext(r.Context())
+
+	if err := pool.Close(email); err != nil {
+		errorResponse(w, fmt.Sprintf("Failed to logout: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, LoginResponse{Success: true, Message: "Logged out"})
+}
+
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, pool.List())
+}
+
+// processDownloadJob runs a single queued job end-to-end. It is invoked by
+// the worker pool, which takes care of marking the job succeeded/failed and
+// retrying it on error.
+func processDownloadJob(job *jobs.Job) error {
 	// 1. Download locally
-	localFilePath, err := runDownload(targetURL)
+	localFilePath, err := runDownload(job.URL, job.Email)
 	if err != nil {
-		log.Printf("❌ Download failed for %s: %v", targetURL, err)
-		return
+		return fmt.Errorf("download failed: %v", err)
 	}
+	defer os.Remove(localFilePath)
 
 	log.Printf("✅ Local download complete: %s", localFilePath)
 
-	// 2. Upload to R2
-	if err := uploadToR2(targetURL, r2Key); err != nil {
-		log.Printf("❌ R2 Upload failed: %v", err)
-		return
+	// 2. Now that we actually have the bytes, detect the real asset type and
+	// correct the placeholder extension baked into the R2 key when the job
+	// was first queued.
+	contentType, ext, err := detectAsset(localFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to detect content type: %v", err)
+	}
+	if finalKey := withExtension(job.R2Key, ext); finalKey != job.R2Key {
+		if err := jobStore.UpdateR2Key(job.ID, finalKey); err != nil {
+			return fmt.Errorf("failed to update r2 key: %v", err)
+		}
+		job.R2Key = finalKey
 	}
 
-	log.Printf("✅ Upload complete: %s", r2Key)
+	// 3. Upload to R2
+	if err := uploadToR2(job, localFilePath, contentType); err != nil {
+		return fmt.Errorf("R2 upload failed: %v", err)
+	}
 
-	// 3. Clean up local file
-	os.Remove(localFilePath)
+	log.Printf("✅ Upload complete: %s", job.R2Key)
+	return nil
+}
+
+// detectAsset inspects the downloaded file to determine its real MIME type
+// and a matching extension, since Freepik assets can be JPEGs, vectors,
+// PSDs or ZIPs despite always landing on the same "Download" button.
+//
+// localPath was saved under download.SuggestedFilename(), so its extension
+// is usually already correct; MIME sniffing the first 512 bytes via
+// http.DetectContentType is the fallback for when that name has none.
+func detectAsset(localPath string) (contentType, ext string, err error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	contentType = http.DetectContentType(buf[:n])
+
+	ext = filepath.Ext(localPath)
+	if ext == "" {
+		if exts, lookupErr := mime.ExtensionsByType(contentType); lookupErr == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	if ext == "" {
+		ext = ".bin"
+	}
+	return contentType, ext, nil
+}
+
+// withExtension returns r2Key with its file extension replaced by ext.
+func withExtension(r2Key, ext string) string {
+	slash := strings.LastIndex(r2Key, "/")
+	dir, base := r2Key[:slash+1], r2Key[slash+1:]
+	if dot := strings.LastIndex(base, "."); dot != -1 {
+		base = base[:dot]
+	}
+	return dir + base + ext
 }
 
 func generateR2Path(originalURL, email string) (string, string) {
+	return generateR2PathNamed(originalURL, email, "")
+}
+
+// generateR2PathNamed behaves like generateR2Path, but if nameOverride is
+// non-empty it is used as the filename instead of the one derived from the
+// URL (used by the bulk importer's filename-override column).
+func generateR2PathNamed(originalURL, email, nameOverride string) (string, string) {
 	// 1. Parse the URL to get the slug
 	// input: https://www.freepik.com/free-ai-image/braided-brown-hair_419054525.htm
 	parsed, _ := url.Parse(originalURL)
@@ -424,30 +719,75 @@ func generateR2Path(originalURL, email string) (string, string) {
 		nameWithoutExt = strings.Join(parts[:len(parts)-1], "_")
 	}
 
-	// Force .jpg (Modify this logic if you handle vectors/zips)
-	finalFilename := nameWithoutExt + ".jpg"
+	if nameOverride != "" {
+		nameWithoutExt = strings.TrimSuffix(nameOverride, filepath.Ext(nameOverride))
+	}
+
+	// The real extension isn't known until the asset is actually downloaded
+	// and sniffed (see detectAsset), so the job starts out under a
+	// placeholder that processDownloadJob corrects in place.
+	finalFilename := nameWithoutExt + ".bin"
 
 	// 2. URL Encode the email
 	encodedEmail := url.QueryEscape(email)
+	objectKey := fmt.Sprintf("%s/%s", encodedEmail, finalFilename)
 
-	// 3. Construct the full URL
-	// Format: R2_URL / encoded_email / filename
+	// Return the Full URL for the user, and the Object Key for R2. Note the
+	// placeholder ".bin" extension above means this URL is only provisional
+	// until the real extension is known — see publicURLForKey.
+	return publicURLForKey(objectKey), objectKey
+}
+
+// publicURLForKey builds the public-facing URL for an R2 object key. Unlike
+// the provisional URL generateR2PathNamed returns at enqueue time, callers
+// should use this against a job's current r2_key (see jobView) to get a URL
+// that reflects the real, sniffed file extension once the download completes.
+func publicURLForKey(r2Key string) string {
 	r2Base := getEnv("R2_URL", "https://storage.stokbro.net")
-	fullURL := fmt.Sprintf("%s/%s/%s", strings.TrimRight(r2Base, "/"), encodedEmail, finalFilename)
+	return fmt.Sprintf("%s/%s", strings.TrimRight(r2Base, "/"), r2Key)
+}
 
-	// Return the Full URL for the user, and the Object Key for R2
-	objectKey := fmt.Sprintf("%s/%s", encodedEmail, finalFilename)
+// progressReader wraps the local download file being streamed to the R2
+// uploader, reporting cumulative bytes handed to the uploader back to
+// onProgress as each part is pulled off the stream, and hashing every byte
+// read so the whole-file SHA256 can be verified once the upload completes.
+//
+// The manager.Uploader only exposes a readerAtSeeker fast path to readers
+// that implement io.ReaderAt; progressReader deliberately implements only
+// io.Seeker, so the uploader falls back to reading it sequentially through
+// Read (see nextReader in the s3 manager package) even though parts are then
+// uploaded concurrently — so hashing here always sees the bytes in file order.
+type progressReader struct {
+	file       *os.File
+	read       int64
+	hash       hash.Hash
+	onProgress func(readSoFar int64)
+}
 
-	return fullURL, objectKey
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.file.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.hash.Write(b[:n])
+	}
+	if p.onProgress != nil {
+		p.onProgress(p.read)
+	}
+	return n, err
 }
 
-func uploadToR2(localPath, objectKey string) error {
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	return p.file.Seek(offset, whence)
+}
+
+// newR2Client builds an S3 client pointed at the Cloudflare R2 account
+// configured via R2_* environment variables. R2 is S3-compatible, so the
+// only difference from a normal S3 client is the endpoint resolver.
+func newR2Client() (*s3.Client, error) {
 	accountId := getEnv("R2_ACCOUNT_ID", "")
 	accessKey := getEnv("R2_ACCESS_KEY", "")
 	secretKey := getEnv("R2_SECRET_KEY", "")
-	bucketName := getEnv("R2_BUCKET_NAME", "")
 
-	// Create S3 Client (R2 is S3 compatible)
 	r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
 		return aws.Endpoint{
 			URL: fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountId),
@@ -460,32 +800,97 @@ func uploadToR2(localPath, objectKey string) error {
 		config.WithRegion("auto"), // R2 ignores region, but SDK requires it
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	client := s3.NewFromConfig(cfg)
+	return s3.NewFromConfig(cfg), nil
+}
+
+// uploadToR2 streams localPath to R2 using the s3 manager's multipart
+// Uploader instead of buffering the whole file into a single PutObject call.
+//
+// The Playwright Go bindings don't expose a CreateReadStream on Download the
+// way the JS/Python bindings do, so there is no live download stream to pipe
+// from; we always stream from the file SaveAs already wrote to disk. That
+// file is itself a seekable os.File, so there is no non-seekable body to
+// handle here.
+//
+// The locally computed SHA256 is compared with R2's only when R2 returns a
+// whole-object checksum; for a multipart upload it is stored unverified.
+func uploadToR2(job *jobs.Job, localPath, contentType string) error {
+	bucketName := getEnv("R2_BUCKET_NAME", "")
+
+	client, err := newR2Client()
+	if err != nil {
+		return err
+	}
 
-	// Open local file
 	file, err := os.Open(localPath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	// Upload
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey), // This is "email/filename.jpg"
-		Body:   file,
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = int64(getEnvInt("R2_UPLOAD_PART_SIZE_MB", 8)) * 1024 * 1024
+		u.Concurrency = getEnvInt("R2_UPLOAD_CONCURRENCY", manager.DefaultUploadConcurrency)
+	})
+
+	body := &progressReader{
+		file: file,
+		hash: sha256.New(),
+		onProgress: func(readSoFar int64) {
+			if err := jobStore.UpdateUploadProgress(job.ID, readSoFar, info.Size()); err != nil {
+				log.Printf("⚠️ Failed to record upload progress for job %d: %v", job.ID, err)
+			}
+		},
+	}
+
+	out, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
+		Bucket:             aws.String(bucketName),
+		Key:                aws.String(job.R2Key), // This is "email/filename.<ext>"
+		Body:               body,
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", filepath.Base(job.R2Key))),
+		ChecksumAlgorithm:  types.ChecksumAlgorithmSha256,
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	localSum := hex.EncodeToString(body.hash.Sum(nil))
+	if remote := aws.ToString(out.ChecksumSHA256); remote != "" {
+		if composite, parts, ok := strings.Cut(remote, "-"); ok {
+			// S3/R2 only returns a whole-object SHA256 for a single-part
+			// PutObject; a multipart upload's ChecksumSHA256 is a composite
+			// digest-of-part-digests (base64-"-"-part-count), not comparable
+			// to a plain SHA256 over the file bytes. Trust our own digest.
+			log.Printf("ℹ️ job %d: R2 returned a composite checksum %s-%s (multipart, %s parts) — storing locally computed SHA256 instead", job.ID, composite, parts, parts)
+		} else if decoded, err := base64.StdEncoding.DecodeString(remote); err != nil {
+			log.Printf("⚠️ job %d: failed to decode R2 checksum %q: %v", job.ID, remote, err)
+		} else if hex.EncodeToString(decoded) != localSum {
+			return fmt.Errorf("checksum mismatch for job %d: local sha256 %s != R2 sha256 %s", job.ID, localSum, hex.EncodeToString(decoded))
+		}
+	}
+
+	if err := jobStore.SetChecksum(job.ID, localSum); err != nil {
+		log.Printf("⚠️ Failed to record checksum for job %d: %v", job.ID, err)
+	}
+
+	return nil
 }
 
-func runDownload(targetURL string) (string, error) {
-	contextMux.RLock()
-	currentContext := browserContext
-	contextMux.RUnlock()
+func runDownload(targetURL, email string) (string, error) {
+	currentContext, _, err := pool.Acquire(email)
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire browser context: %v", err)
+	}
+	defer pool.Release(email)
 
 	log.Println("3. Creating new page from logged-in context...")
 	page, err := currentContext.NewPage()
@@ -585,3 +990,16 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid value for %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}